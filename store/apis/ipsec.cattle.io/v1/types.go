@@ -0,0 +1,69 @@
+// Package v1 contains the API Schema definitions for the ipsec.cattle.io
+// v1 API group: IPsecPeer (one per node) and IPsecTunnel (one per
+// workload), the custom resources the KubernetesStore watches in
+// place of Rancher host/container metadata.
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// IPsecPeer represents a node that participates in the ipsec mesh.
+// Its name is the node name, matching Rancher's notion of a host.
+type IPsecPeer struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec IPsecPeerSpec `json:"spec,omitempty"`
+}
+
+// IPsecPeerSpec is the desired state of an IPsecPeer.
+type IPsecPeerSpec struct {
+	// AgentIP is the routable address other peers use to reach this
+	// node's ipsec endpoint.
+	AgentIP string `json:"agentIP"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// IPsecPeerList is a list of IPsecPeer.
+type IPsecPeerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []IPsecPeer `json:"items"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// IPsecTunnel represents a single workload endpoint that needs a
+// tunnel to its host peer, analogous to a Rancher container entry.
+type IPsecTunnel struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec IPsecTunnelSpec `json:"spec,omitempty"`
+}
+
+// IPsecTunnelSpec is the desired state of an IPsecTunnel.
+type IPsecTunnelSpec struct {
+	// PodIP is the workload's address.
+	PodIP string `json:"podIP"`
+	// SubnetPrefix is appended to PodIP to form the SPD selector,
+	// e.g. "/32" or "/16".
+	SubnetPrefix string `json:"subnetPrefix"`
+	// HostAgentIP is the AgentIP of the IPsecPeer running this workload.
+	HostAgentIP string `json:"hostAgentIP"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// IPsecTunnelList is a list of IPsecTunnel.
+type IPsecTunnelList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []IPsecTunnel `json:"items"`
+}
@@ -0,0 +1,288 @@
+package store
+
+import (
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/leodotcloud/log"
+)
+
+const (
+	// consulHostTag marks a catalog node registration as an ipsec
+	// agent host, analogous to Rancher's "ipsec" network.
+	consulHostTag = "ipsec-host"
+
+	// consulTunnelServicePrefix is prepended to the name of any
+	// service registration that should be treated as a tunnel
+	// endpoint, e.g. "ipsec-tunnel-myapp".
+	consulTunnelServicePrefix = "ipsec-tunnel-"
+
+	// consulAgentIPMetaKey is the node meta key holding the AgentIP
+	// to use for that node's ipsec tunnel.
+	consulAgentIPMetaKey = "ipsec-agent-ip"
+)
+
+// ConsulStore is a Store backed by a Consul catalog. On every Reload it
+// lists the catalog, taking nodes that carry the consulHostTag node
+// meta key as peers and services named with the
+// consulTunnelServicePrefix as tunnel endpoints, so the ipsec agent
+// can run against a Consul cluster instead of Rancher metadata. It
+// does not hold a blocking watch on the catalog between Reloads.
+type ConsulStore struct {
+	client *api.Client
+	selfID string
+
+	mu                sync.RWMutex
+	self              Entry
+	entries           []Entry
+	local             map[string]Entry
+	remote            map[string]Entry
+	peersMap          map[string]Entry
+	remoteNonPeersMap map[string]Entry
+	eventPublisher
+}
+
+// NewConsulStore creates, initializes and returns a Store backed by
+// the Consul agent reachable at consulAddress (host:port, or "" to use
+// the Consul client library's default of the local agent).
+func NewConsulStore(consulAddress, selfNodeID string) (*ConsulStore, error) {
+	conf := api.DefaultConfig()
+	if consulAddress != "" {
+		conf.Address = consulAddress
+	}
+
+	log.Debugf("Creating new ConsulStore, consulAddress: %v, selfNodeID: %v", consulAddress, selfNodeID)
+	client, err := api.NewClient(conf)
+	if err != nil {
+		log.Errorf("couldn't create consul client: %v", err)
+		return nil, err
+	}
+
+	return &ConsulStore{
+		client: client,
+		selfID: selfNodeID,
+	}, nil
+}
+
+// LocalIPAddress returns the IP address of the current agent.
+func (cs *ConsulStore) LocalIPAddress() string {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	if !cs.self.IPAddress.IsValid() {
+		return ""
+	}
+	return cs.self.IPAddress.Addr().String()
+}
+
+// IsRemote is used to check if the given IP addresss is available on the local host or remote
+func (cs *ConsulStore) IsRemote(ipAddress string) bool {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	if _, ok := cs.local[ipAddress]; ok {
+		log.Debugf("Local: %s", ipAddress)
+		return false
+	}
+
+	_, ok := cs.remote[ipAddress]
+	if ok {
+		log.Debugf("Remote: %s", ipAddress)
+	}
+	return ok
+}
+
+// Entries is used to get all the entries in the database
+func (cs *ConsulStore) Entries() []Entry {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.entries
+}
+
+// PeerEntriesMap is used to get a map of entries with only the peers
+func (cs *ConsulStore) PeerEntriesMap() map[string]Entry {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.peersMap
+}
+
+// RemoteNonPeerEntriesMap is used to get a map of all entries which are remote
+func (cs *ConsulStore) RemoteNonPeerEntriesMap() map[string]Entry {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.remoteNonPeersMap
+}
+
+// Diagnostics returns a snapshot of the store's internal state for
+// introspection.
+func (cs *ConsulStore) Diagnostics() Diagnostics {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	return Diagnostics{
+		Entries:           cs.entries,
+		Local:             cs.local,
+		Remote:            cs.remote,
+		PeersMap:          cs.peersMap,
+		RemoteNonPeersMap: cs.remoteNonPeersMap,
+	}
+}
+
+// nodeAgentIP returns the AgentIP for a catalog node, preferring the
+// consulAgentIPMetaKey node meta value and falling back to the node's
+// registered address.
+func nodeAgentIP(n *api.Node) string {
+	if ip, ok := n.Meta[consulAgentIPMetaKey]; ok && ip != "" {
+		return ip
+	}
+	return n.Address
+}
+
+func (cs *ConsulStore) buildPeersMap(nodes []*api.Node) map[string]Entry {
+	peersMap := make(map[string]Entry)
+
+	for _, n := range nodes {
+		addr, err := netip.ParseAddr(nodeAgentIP(n))
+		if err != nil {
+			log.Errorf("couldn't parse agent IP for node %v: %v", n.Node, err)
+			continue
+		}
+
+		e := Entry{
+			IPAddress:     netip.PrefixFrom(addr, hostPrefixBits(addr)),
+			HostIPAddress: addr,
+			Self:          n.ID == cs.selfID,
+			Peer:          true,
+		}
+		peersMap[addr.String()] = e
+	}
+
+	return peersMap
+}
+
+// Reload is used to refresh/reload the data from the Consul catalog
+func (cs *ConsulStore) Reload() error {
+	log.Debugf("Reloading ...")
+
+	nodes, _, err := cs.client.Catalog().Nodes(&api.QueryOptions{NodeMeta: map[string]string{}})
+	if err != nil {
+		log.Errorf("couldn't list catalog nodes: %v", err)
+		return err
+	}
+
+	var hostNodes []*api.Node
+	for _, n := range nodes {
+		full, _, err := cs.client.Catalog().Node(n.Node, nil)
+		if err != nil {
+			log.Errorf("couldn't get catalog node %v: %v", n.Node, err)
+			continue
+		}
+		if _, ok := full.Node.Meta[consulHostTag]; ok {
+			hostNodes = append(hostNodes, full.Node)
+		}
+	}
+
+	services, _, err := cs.client.Catalog().Services(nil)
+	if err != nil {
+		log.Errorf("couldn't list catalog services: %v", err)
+		return err
+	}
+
+	peersMap := cs.buildPeersMap(hostNodes)
+
+	for _, n := range hostNodes {
+		if n.ID == cs.selfID {
+			if addr, err := netip.ParseAddr(nodeAgentIP(n)); err == nil {
+				if e, ok := peersMap[addr.String()]; ok {
+					cs.mu.Lock()
+					cs.self = e
+					cs.mu.Unlock()
+				}
+			}
+			break
+		}
+	}
+
+	entries := []Entry{}
+	local := map[string]Entry{}
+	remote := map[string]Entry{}
+	remoteNonPeersMap := map[string]Entry{}
+
+	for serviceName := range services {
+		if !strings.HasPrefix(serviceName, consulTunnelServicePrefix) {
+			continue
+		}
+
+		svcEntries, _, err := cs.client.Catalog().Service(serviceName, "", nil)
+		if err != nil {
+			log.Errorf("couldn't list catalog service %v: %v", serviceName, err)
+			continue
+		}
+
+		for _, svc := range svcEntries {
+			hostAgentIP := svc.Address
+			if ip, ok := svc.NodeMeta[consulAgentIPMetaKey]; ok && ip != "" {
+				hostAgentIP = ip
+			}
+
+			addr, err := netip.ParseAddr(svc.ServiceAddress)
+			if err != nil {
+				log.Errorf("couldn't parse service address %v for %v: %v", svc.ServiceAddress, serviceName, err)
+				continue
+			}
+			hostAddr, err := netip.ParseAddr(hostAgentIP)
+			if err != nil {
+				log.Errorf("couldn't parse host agent IP %v for %v: %v", hostAgentIP, serviceName, err)
+				continue
+			}
+
+			e := Entry{
+				IPAddress:     netip.PrefixFrom(addr, hostPrefixBits(addr)),
+				HostIPAddress: hostAddr,
+				Self:          svc.ID == cs.selfID,
+				Peer:          false,
+			}
+
+			ipNoCidr := addr.String()
+			if e.HostIPAddress == cs.self.HostIPAddress {
+				local[ipNoCidr] = e
+			} else {
+				remote[ipNoCidr] = e
+				if !e.Peer {
+					remoteNonPeersMap[ipNoCidr] = e
+				}
+			}
+			entries = append(entries, e)
+		}
+	}
+
+	cs.mu.Lock()
+	oldByKey := map[string]Entry{}
+	for k, e := range cs.local {
+		oldByKey[k] = e
+	}
+	for k, e := range cs.remote {
+		oldByKey[k] = e
+	}
+	newByKey := map[string]Entry{}
+	for k, e := range local {
+		newByKey[k] = e
+	}
+	for k, e := range remote {
+		newByKey[k] = e
+	}
+	oldPeersMap := cs.peersMap
+
+	cs.entries = entries
+	cs.peersMap = peersMap
+	cs.local = local
+	cs.remote = remote
+	cs.remoteNonPeersMap = remoteNonPeersMap
+	cs.mu.Unlock()
+
+	cs.diffEntries(oldByKey, newByKey)
+	cs.diffPeers(oldPeersMap, peersMap)
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/leodotcloud/log"
+)
+
+// EntryStatus records the last known dataplane state of a single
+// tunnel entry, as reported by the ipsec configurator after it
+// attempts to install/maintain the SA for that entry.
+type EntryStatus struct {
+	LastSuccessAt time.Time `json:"lastSuccessAt,omitempty"`
+	LastError     string    `json:"lastError,omitempty"`
+	LastErrorAt   time.Time `json:"lastErrorAt,omitempty"`
+	PacketsIn     uint64    `json:"packetsIn,omitempty"`
+	PacketsOut    uint64    `json:"packetsOut,omitempty"`
+}
+
+// StatusTracker is a concurrency-safe table of EntryStatus keyed by IP
+// address. The ipsec configurator records outcomes into it as it
+// installs/tears down tunnels; ServeDiagnostics reads it back out.
+type StatusTracker struct {
+	mu       sync.RWMutex
+	statuses map[string]EntryStatus
+}
+
+// NewStatusTracker creates an empty StatusTracker.
+func NewStatusTracker() *StatusTracker {
+	return &StatusTracker{statuses: map[string]EntryStatus{}}
+}
+
+// RecordSuccess marks ipAddress as having a successful SA as of now,
+// clearing any previously recorded error.
+func (t *StatusTracker) RecordSuccess(ipAddress string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.statuses[ipAddress]
+	s.LastSuccessAt = time.Now()
+	s.LastError = ""
+	t.statuses[ipAddress] = s
+}
+
+// RecordError records that installing/maintaining the SA for
+// ipAddress failed with err.
+func (t *StatusTracker) RecordError(ipAddress string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.statuses[ipAddress]
+	s.LastError = err.Error()
+	s.LastErrorAt = time.Now()
+	t.statuses[ipAddress] = s
+}
+
+// RecordCounters updates the last known packet counters for ipAddress.
+func (t *StatusTracker) RecordCounters(ipAddress string, packetsIn, packetsOut uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.statuses[ipAddress]
+	s.PacketsIn = packetsIn
+	s.PacketsOut = packetsOut
+	t.statuses[ipAddress] = s
+}
+
+// Snapshot returns a copy of every status currently recorded.
+func (t *StatusTracker) Snapshot() map[string]EntryStatus {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	snap := make(map[string]EntryStatus, len(t.statuses))
+	for k, v := range t.statuses {
+		snap[k] = v
+	}
+	return snap
+}
+
+// Diagnostics is the raw internal state a Store implementation exposes
+// for introspection, analogous to `docker network inspect --verbose`.
+type Diagnostics struct {
+	Entries           []Entry                `json:"entries"`
+	Local             map[string]Entry       `json:"local"`
+	Remote            map[string]Entry       `json:"remote"`
+	PeersMap          map[string]Entry       `json:"peersMap"`
+	RemoteNonPeersMap map[string]Entry       `json:"remoteNonPeersMap"`
+	Statuses          map[string]EntryStatus `json:"statuses,omitempty"`
+}
+
+// Diagnosable is implemented by Store backends that can report their
+// raw internal state.
+type Diagnosable interface {
+	Diagnostics() Diagnostics
+}
+
+// VerboseDiagnosable is implemented by Store backends that have
+// additional source-of-truth state worth dumping under ?verbose=true,
+// e.g. MetadataStore's InfoFromMetadata.
+type VerboseDiagnosable interface {
+	VerboseDiagnostics() interface{}
+}
+
+// ServeDiagnostics starts an HTTP server on addr exposing JSON dumps of
+// s's internal state at GET /, optionally including backend-specific
+// verbose state when called as GET /?verbose=true. statuses may be nil
+// if the caller isn't tracking per-entry dataplane status. It returns
+// immediately; the server runs until the process exits.
+func ServeDiagnostics(addr string, s Diagnosable, statuses *StatusTracker) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		diag := s.Diagnostics()
+		if statuses != nil {
+			diag.Statuses = statuses.Snapshot()
+		}
+
+		resp := map[string]interface{}{
+			"diagnostics": diag,
+		}
+
+		if r.URL.Query().Get("verbose") == "true" {
+			if vs, ok := s.(VerboseDiagnosable); ok {
+				resp["verbose"] = vs.VerboseDiagnostics()
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Errorf("couldn't encode diagnostics response: %v", err)
+		}
+	})
+
+	log.Infof("Serving diagnostics on %v", addr)
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Errorf("diagnostics server exited: %v", err)
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"sync"
+
+	"github.com/leodotcloud/log"
+)
+
+// StoreEventType identifies what changed in a StoreEvent.
+type StoreEventType int
+
+const (
+	// EntryAdded is emitted when a new tunnel entry is discovered.
+	EntryAdded StoreEventType = iota
+	// EntryRemoved is emitted when a previously known entry disappears.
+	EntryRemoved
+	// EntryChanged is emitted when a known entry's fields change.
+	EntryChanged
+	// PeerAdded is emitted when a new ipsec peer is discovered.
+	PeerAdded
+	// PeerRemoved is emitted when a previously known peer disappears.
+	PeerRemoved
+)
+
+// StoreEvent is a single, targeted change to a Store's view of the
+// world, as opposed to a full Entries()/PeerEntriesMap() snapshot.
+type StoreEvent struct {
+	Type  StoreEventType
+	Key   string
+	Entry Entry
+}
+
+// eventPublisher implements the Subscribe()/diffing bookkeeping shared
+// by every Store backend, so Reload can fan out just the entries and
+// peers that actually changed instead of forcing callers to
+// reconcile a full snapshot on every poll.
+type eventPublisher struct {
+	mu   sync.RWMutex
+	subs []chan StoreEvent
+}
+
+// Subscribe returns a channel on which StoreEvents are delivered as
+// Reload detects changes. The channel is buffered; a subscriber that
+// falls behind has the oldest-pending-to-deliver event dropped rather
+// than blocking Reload, and should periodically reconcile against
+// Entries()/PeerEntriesMap() to recover.
+func (p *eventPublisher) Subscribe() <-chan StoreEvent {
+	ch := make(chan StoreEvent, 64)
+
+	p.mu.Lock()
+	p.subs = append(p.subs, ch)
+	p.mu.Unlock()
+
+	return ch
+}
+
+func (p *eventPublisher) publish(ev StoreEvent) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, ch := range p.subs {
+		select {
+		case ch <- ev:
+		default:
+			select {
+			case old := <-ch:
+				log.Errorf("dropping store event %+v, subscriber channel is full", old)
+			default:
+			}
+
+			select {
+			case ch <- ev:
+			default:
+				log.Errorf("dropping store event %+v, subscriber channel is full", ev)
+			}
+		}
+	}
+}
+
+// diffEntries compares the previous and current entry snapshots
+// (both keyed the way local/remote are, i.e. by bare IP address) and
+// publishes EntryAdded/EntryRemoved/EntryChanged for every difference.
+func (p *eventPublisher) diffEntries(old, new map[string]Entry) {
+	for k, ne := range new {
+		if oe, ok := old[k]; !ok {
+			p.publish(StoreEvent{Type: EntryAdded, Key: k, Entry: ne})
+		} else if oe != ne {
+			p.publish(StoreEvent{Type: EntryChanged, Key: k, Entry: ne})
+		}
+	}
+	for k, oe := range old {
+		if _, ok := new[k]; !ok {
+			p.publish(StoreEvent{Type: EntryRemoved, Key: k, Entry: oe})
+		}
+	}
+}
+
+// diffPeers compares the previous and current peersMap snapshots and
+// publishes PeerAdded/PeerRemoved for every difference.
+func (p *eventPublisher) diffPeers(old, new map[string]Entry) {
+	for k, ne := range new {
+		if _, ok := old[k]; !ok {
+			p.publish(StoreEvent{Type: PeerAdded, Key: k, Entry: ne})
+		}
+	}
+	for k, oe := range old {
+		if _, ok := new[k]; !ok {
+			p.publish(StoreEvent{Type: PeerRemoved, Key: k, Entry: oe})
+		}
+	}
+}
@@ -0,0 +1,9 @@
+// Package versioned is generated by client-gen from the types in
+// store/apis/ipsec.cattle.io/v1. Do not edit by hand; regenerate with
+// client-gen whenever the CRD types change.
+//
+// Interface is the entry point used throughout this package:
+//
+//	clientset.IpsecV1().IPsecPeers().List(opts)
+//	clientset.IpsecV1().IPsecTunnels(namespace).Watch(opts)
+package versioned
@@ -0,0 +1,288 @@
+package store
+
+import (
+	"net/netip"
+	"sync"
+
+	"github.com/leodotcloud/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+
+	ipsecv1 "github.com/leodotcloud/ipsec/store/apis/ipsec.cattle.io/v1"
+	ipsecclientset "github.com/leodotcloud/ipsec/store/generated/clientset/versioned"
+)
+
+// KubernetesStore is a Store backed by two CRDs: one IPsecPeer per
+// node (equivalent to a Rancher host) and one IPsecTunnel per
+// workload (equivalent to a container). It watches both via informers
+// so Reload is cheap and can be called on every resync.
+type KubernetesStore struct {
+	clientset ipsecclientset.Interface
+	nodeName  string
+
+	peerInformer   cache.SharedIndexInformer
+	tunnelInformer cache.SharedIndexInformer
+	stopCh         chan struct{}
+
+	mu                sync.RWMutex
+	self              Entry
+	entries           []Entry
+	local             map[string]Entry
+	remote            map[string]Entry
+	peersMap          map[string]Entry
+	remoteNonPeersMap map[string]Entry
+	eventPublisher
+}
+
+// NewKubernetesStore creates, initializes and returns a Store backed
+// by the IPsecPeer/IPsecTunnel custom resources in the cluster named
+// by kubeconfig or, if kubeconfig is empty, the cluster the agent's
+// pod is running in. nodeName identifies which IPsecPeer is "self".
+func NewKubernetesStore(kubeconfig, nodeName string) (*KubernetesStore, error) {
+	config, err := loadKubernetesConfig(kubeconfig)
+	if err != nil {
+		log.Errorf("couldn't load kubernetes config: %v", err)
+		return nil, err
+	}
+
+	clientset, err := ipsecclientset.NewForConfig(config)
+	if err != nil {
+		log.Errorf("couldn't create ipsec clientset: %v", err)
+		return nil, err
+	}
+
+	ks := &KubernetesStore{
+		clientset: clientset,
+		nodeName:  nodeName,
+		stopCh:    make(chan struct{}),
+	}
+
+	ks.peerInformer = cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(opts metav1ListOptions) (runtime.Object, error) {
+				return ks.clientset.IpsecV1().IPsecPeers().List(opts)
+			},
+			WatchFunc: func(opts metav1ListOptions) (watch.Interface, error) {
+				return ks.clientset.IpsecV1().IPsecPeers().Watch(opts)
+			},
+		},
+		&ipsecv1.IPsecPeer{},
+		0,
+		cache.Indexers{},
+	)
+
+	ks.tunnelInformer = cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(opts metav1ListOptions) (runtime.Object, error) {
+				return ks.clientset.IpsecV1().IPsecTunnels(metav1NamespaceAll).List(opts)
+			},
+			WatchFunc: func(opts metav1ListOptions) (watch.Interface, error) {
+				return ks.clientset.IpsecV1().IPsecTunnels(metav1NamespaceAll).Watch(opts)
+			},
+		},
+		&ipsecv1.IPsecTunnel{},
+		0,
+		cache.Indexers{},
+	)
+
+	go ks.peerInformer.Run(ks.stopCh)
+	go ks.tunnelInformer.Run(ks.stopCh)
+
+	cache.WaitForCacheSync(ks.stopCh, ks.peerInformer.HasSynced, ks.tunnelInformer.HasSynced)
+
+	return ks, nil
+}
+
+// LocalIPAddress returns the IP address of the current agent.
+func (ks *KubernetesStore) LocalIPAddress() string {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if !ks.self.IPAddress.IsValid() {
+		return ""
+	}
+	return ks.self.IPAddress.Addr().String()
+}
+
+// IsRemote is used to check if the given IP addresss is available on the local host or remote
+func (ks *KubernetesStore) IsRemote(ipAddress string) bool {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	if _, ok := ks.local[ipAddress]; ok {
+		log.Debugf("Local: %s", ipAddress)
+		return false
+	}
+
+	_, ok := ks.remote[ipAddress]
+	if ok {
+		log.Debugf("Remote: %s", ipAddress)
+	}
+	return ok
+}
+
+// Entries is used to get all the entries in the database
+func (ks *KubernetesStore) Entries() []Entry {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.entries
+}
+
+// PeerEntriesMap is used to get a map of entries with only the peers
+func (ks *KubernetesStore) PeerEntriesMap() map[string]Entry {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.peersMap
+}
+
+// RemoteNonPeerEntriesMap is used to get a map of all entries which are remote
+func (ks *KubernetesStore) RemoteNonPeerEntriesMap() map[string]Entry {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.remoteNonPeersMap
+}
+
+// Diagnostics returns a snapshot of the store's internal state for
+// introspection.
+func (ks *KubernetesStore) Diagnostics() Diagnostics {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	return Diagnostics{
+		Entries:           ks.entries,
+		Local:             ks.local,
+		Remote:            ks.remote,
+		PeersMap:          ks.peersMap,
+		RemoteNonPeersMap: ks.remoteNonPeersMap,
+	}
+}
+
+func (ks *KubernetesStore) buildPeersMap() map[string]Entry {
+	peersMap := make(map[string]Entry)
+
+	for _, obj := range ks.peerInformer.GetStore().List() {
+		p := obj.(*ipsecv1.IPsecPeer)
+
+		addr, err := netip.ParseAddr(p.Spec.AgentIP)
+		if err != nil {
+			log.Errorf("couldn't parse AgentIP for IPsecPeer %v: %v", p.Name, err)
+			continue
+		}
+
+		e := Entry{
+			IPAddress:     netip.PrefixFrom(addr, hostPrefixBits(addr)),
+			HostIPAddress: addr,
+			Self:          p.Name == ks.nodeName,
+			Peer:          true,
+		}
+		peersMap[addr.String()] = e
+	}
+
+	return peersMap
+}
+
+// Reload is used to refresh/reload the data from the informer caches
+func (ks *KubernetesStore) Reload() error {
+	log.Debugf("Reloading ...")
+
+	peersMap := ks.buildPeersMap()
+
+	var self Entry
+	for _, e := range peersMap {
+		if e.Self {
+			self = e
+			break
+		}
+	}
+
+	entries := []Entry{}
+	local := map[string]Entry{}
+	remote := map[string]Entry{}
+	remoteNonPeersMap := map[string]Entry{}
+
+	for _, obj := range ks.tunnelInformer.GetStore().List() {
+		t := obj.(*ipsecv1.IPsecTunnel)
+
+		if t.Spec.PodIP == "" || t.Spec.HostAgentIP == "" {
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(t.Spec.PodIP + t.Spec.SubnetPrefix)
+		if err != nil {
+			log.Errorf("couldn't parse PodIP/SubnetPrefix %v%v for IPsecTunnel %v: %v", t.Spec.PodIP, t.Spec.SubnetPrefix, t.Name, err)
+			continue
+		}
+		hostAddr, err := netip.ParseAddr(t.Spec.HostAgentIP)
+		if err != nil {
+			log.Errorf("couldn't parse HostAgentIP for IPsecTunnel %v: %v", t.Name, err)
+			continue
+		}
+
+		e := Entry{
+			IPAddress:     prefix,
+			HostIPAddress: hostAddr,
+			Self:          hostAddr == self.HostIPAddress,
+			Peer:          false,
+		}
+
+		ipNoCidr := prefix.Addr().String()
+		if e.HostIPAddress == self.HostIPAddress {
+			local[ipNoCidr] = e
+		} else {
+			remote[ipNoCidr] = e
+			if !e.Peer {
+				remoteNonPeersMap[ipNoCidr] = e
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	ks.mu.Lock()
+	oldByKey := map[string]Entry{}
+	for k, e := range ks.local {
+		oldByKey[k] = e
+	}
+	for k, e := range ks.remote {
+		oldByKey[k] = e
+	}
+	newByKey := map[string]Entry{}
+	for k, e := range local {
+		newByKey[k] = e
+	}
+	for k, e := range remote {
+		newByKey[k] = e
+	}
+	oldPeersMap := ks.peersMap
+
+	ks.self = self
+	ks.entries = entries
+	ks.peersMap = peersMap
+	ks.local = local
+	ks.remote = remote
+	ks.remoteNonPeersMap = remoteNonPeersMap
+	ks.mu.Unlock()
+
+	ks.diffEntries(oldByKey, newByKey)
+	ks.diffPeers(oldPeersMap, peersMap)
+
+	return nil
+}
+
+func loadKubernetesConfig(kubeconfigPath string) (*rest.Config, error) {
+	if kubeconfigPath != "" {
+		return clientcmdBuildConfigFromFlags("", kubeconfigPath)
+	}
+	return rest.InClusterConfig()
+}
+
+// metav1ListOptions is a local alias so the informer wiring above
+// reads like the rest of this package rather than a wall of
+// k8s.io/apimachinery imports.
+type metav1ListOptions = metav1.ListOptions
+
+const metav1NamespaceAll = metav1.NamespaceAll
+
+var clientcmdBuildConfigFromFlags = clientcmd.BuildConfigFromFlags
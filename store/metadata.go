@@ -2,8 +2,10 @@ package store
 
 import (
 	"fmt"
-	"net"
+	"net/netip"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/leodotcloud/log"
 	"github.com/rancher/go-rancher-metadata/metadata"
@@ -11,7 +13,12 @@ import (
 
 const (
 	metadataURLTemplate = "http://%v/2015-12-19"
-	defaultSubnetPrefix = "/16"
+
+	// defaultSubnetPrefixV4 and defaultSubnetPrefixV6 are used when a
+	// network's cniConfig doesn't specify a subnetPrefixSize for that
+	// address family.
+	defaultSubnetPrefixV4 = 16
+	defaultSubnetPrefixV6 = 64
 
 	// DefaultMetadataAddress specifies the default value to use if nothing is specified
 	DefaultMetadataAddress = "169.254.169.250"
@@ -19,7 +26,11 @@ const (
 
 // MetadataStore contains information related to metadata client, etc
 type MetadataStore struct {
-	mc                metadata.Client
+	mc       metadata.Client
+	peerings map[string]Peering
+	resolver *hostnameResolver
+
+	mu                sync.RWMutex
 	self              Entry
 	entries           []Entry
 	local             map[string]Entry
@@ -27,20 +38,30 @@ type MetadataStore struct {
 	peersMap          map[string]Entry
 	remoteNonPeersMap map[string]Entry
 	info              *InfoFromMetadata
+	vipAllocator      *vipAllocator
+	serviceVIPs       map[string]ServiceVIPEntry
+	eventPublisher
 }
 
 // InfoFromMetadata stores the information that has been fetched from
 // metadata server
 type InfoFromMetadata struct {
-	selfHost                metadata.Host
-	selfNetwork             metadata.Network
-	selfNetworkSubnetPrefix string
-	services                []metadata.Service
-	servicesMapByName       map[string][]*metadata.Service
-	hosts                   []metadata.Host
-	containers              []metadata.Container
-	hostsMap                map[string]metadata.Host
-	networksMap             map[string]metadata.Network
+	selfHost                  metadata.Host
+	selfNetwork               metadata.Network
+	selfNetworkSubnetPrefixes subnetPrefixSizes
+	services                  []metadata.Service
+	servicesMapByName         map[string][]*metadata.Service
+	hosts                     []metadata.Host
+	containers                []metadata.Container
+	hostsMap                  map[string]metadata.Host
+	networksMap               map[string]metadata.Network
+}
+
+// subnetPrefixSizes holds the per-address-family prefix length to use
+// when turning a container's bare IP into a CIDR entry.
+type subnetPrefixSizes struct {
+	v4 int
+	v6 int
 }
 
 // NewMetadataStoreWithClientIP creates, intializes and returns a store for use with a specific Client IP to contact the metadata
@@ -59,6 +80,8 @@ func NewMetadataStoreWithClientIP(metadataAddress, clientIP string) (*MetadataSt
 
 	ms := &MetadataStore{}
 	ms.mc = mc
+	ms.resolver = newHostnameResolver(0)
+	go ms.resolver.Run()
 
 	return ms, nil
 }
@@ -79,28 +102,37 @@ func NewMetadataStore(metadataAddress string) (*MetadataStore, error) {
 
 	ms := &MetadataStore{}
 	ms.mc = mc
+	ms.resolver = newHostnameResolver(0)
+	go ms.resolver.Run()
 
 	return ms, nil
 }
 
 // LocalHostIPAddress returns the IP address of the host where the agent is running
 func (ms *MetadataStore) LocalHostIPAddress() string {
-	return ms.self.HostIPAddress
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.self.HostIPAddress.String()
 }
 
 // LocalIPAddress returns the IP address of the current agent
 func (ms *MetadataStore) LocalIPAddress() string {
-	ip, _, err := net.ParseCIDR(ms.self.IPAddress)
-	if err != nil {
-		log.Errorf("error: %v", err)
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	if !ms.self.IPAddress.IsValid() {
+		log.Errorf("self entry has no valid IP address yet")
 		return ""
 	}
 
-	return ip.String()
+	return ms.self.IPAddress.Addr().String()
 }
 
 // IsRemote is used to check if the given IP addresss is available on the local host or remote
 func (ms *MetadataStore) IsRemote(ipAddress string) bool {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
 	if _, ok := ms.local[ipAddress]; ok {
 		log.Debugf("Local: %s", ipAddress)
 		return false
@@ -115,6 +147,8 @@ func (ms *MetadataStore) IsRemote(ipAddress string) bool {
 
 // Entries is used to get all the entries in the database
 func (ms *MetadataStore) Entries() []Entry {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
 	return ms.entries
 }
 
@@ -123,29 +157,58 @@ func (ms *MetadataStore) buildPeersMap() map[string]Entry {
 
 	for _, h := range ms.info.hosts {
 		isSelf := h.UUID == ms.info.selfHost.UUID
-		e := Entry{
-			h.AgentIP + "/32",
-			h.AgentIP,
-			isSelf,
-			true,
+
+		e, ok := ms.getEntryFromHost(h)
+		if !ok {
+			continue
 		}
-		peersMap[h.AgentIP] = e
+		e.Self = isSelf
+		peersMap[e.IPAddress.Addr().String()] = e
 	}
 
 	return peersMap
 }
 
-func (ms *MetadataStore) getEntryFromHost(h metadata.Host) (Entry, error) {
-	isSelf := h.UUID == ms.info.selfHost.UUID
+// resolveAgentAddress classifies addr and, if it's a hostname, resolves
+// it to a routable IP via ms.resolver. IP literals are returned as-is.
+func (ms *MetadataStore) resolveAgentAddress(addr string) (string, addressType) {
+	addrType := classifyAddress(addr)
+	if addrType == ipAddressType {
+		return addr, ipAddressType
+	}
+
+	ips := ms.resolver.Resolve(addr)
+	if len(ips) == 0 {
+		log.Errorf("couldn't resolve agent hostname %v, skipping until it resolves", addr)
+		return "", hostnameAddressType
+	}
+	return ips[0], hostnameAddressType
+}
+
+// getEntryFromHost builds the peer Entry for h, resolving h.AgentIP if
+// it's a hostname rather than an IP literal. The bool return is false
+// if the address couldn't be resolved to anything usable yet.
+func (ms *MetadataStore) getEntryFromHost(h metadata.Host) (Entry, bool) {
+	resolvedIP, addrType := ms.resolveAgentAddress(h.AgentIP)
+	if resolvedIP == "" {
+		return Entry{}, false
+	}
+
+	addr, err := netip.ParseAddr(resolvedIP)
+	if err != nil {
+		log.Errorf("couldn't parse agent address %v for host %v: %v", resolvedIP, h.UUID, err)
+		return Entry{}, false
+	}
 
 	entry := Entry{
-		h.AgentIP + "/32",
-		h.AgentIP,
-		isSelf,
-		true,
+		IPAddress:       netip.PrefixFrom(addr, hostPrefixBits(addr)),
+		HostIPAddress:   addr,
+		Self:            h.UUID == ms.info.selfHost.UUID,
+		Peer:            true,
+		HostAddressType: addrType,
 	}
 
-	return entry, nil
+	return entry, true
 }
 
 func getSelfNetwork(networks []metadata.Network) metadata.Network {
@@ -159,35 +222,132 @@ func getSelfNetwork(networks []metadata.Network) metadata.Network {
 	return selfNetwork
 }
 
-func (ms *MetadataStore) getEntryFromContainer(c metadata.Container) (Entry, error) {
-	isPeer := false
-	isSelf := false
+// getEntriesFromContainer returns one Entry per address family c has an
+// address in (c.PrimaryIp, and an IPv6 literal out of c.Ips if it has
+// one), each routed through c's host.
+func (ms *MetadataStore) getEntriesFromContainer(c metadata.Container) []Entry {
+	var entries []Entry
 
-	entry := Entry{
-		c.PrimaryIp + ms.info.selfNetworkSubnetPrefix,
-		ms.info.hostsMap[c.HostUUID].AgentIP,
-		isSelf,
-		isPeer,
+	host, ok := ms.info.hostsMap[c.HostUUID]
+	if !ok {
+		log.Errorf("couldn't find host %v for container with primary IP %v", c.HostUUID, c.PrimaryIp)
+		return entries
 	}
 
-	return entry, nil
+	resolvedIP, addrType := ms.resolveAgentAddress(host.AgentIP)
+	if resolvedIP == "" {
+		log.Errorf("couldn't resolve host agent address %v for container with primary IP %v, skipping until it resolves", host.AgentIP, c.PrimaryIp)
+		return entries
+	}
+
+	hostAddr, err := netip.ParseAddr(resolvedIP)
+	if err != nil {
+		log.Errorf("couldn't parse host agent IP %v: %v", resolvedIP, err)
+		return entries
+	}
+
+	if c.PrimaryIp != "" {
+		if addr, err := netip.ParseAddr(c.PrimaryIp); err != nil {
+			log.Errorf("couldn't parse container primary IP %v: %v", c.PrimaryIp, err)
+		} else {
+			entries = append(entries, Entry{
+				IPAddress:       netip.PrefixFrom(addr, ms.info.selfNetworkSubnetPrefixes.v4),
+				HostIPAddress:   hostAddr,
+				HostAddressType: addrType,
+			})
+		}
+	}
+
+	if ip6, ok := primaryIp6FromIps(c.Ips); ok {
+		entries = append(entries, Entry{
+			IPAddress:       netip.PrefixFrom(ip6, ms.info.selfNetworkSubnetPrefixes.v6),
+			HostIPAddress:   hostAddr,
+			HostAddressType: addrType,
+		})
+	}
+
+	return entries
+}
+
+// primaryIp6FromIps returns the first IPv6 literal in ips.
+// metadata.Container has no PrimaryIp6 field of its own (only an IPv4
+// PrimaryIp and this combined Ips list), so dual-stack containers'
+// IPv6 address has to be picked out of Ips instead.
+func primaryIp6FromIps(ips []string) (netip.Addr, bool) {
+	for _, ip := range ips {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			continue
+		}
+		if addr.Is6() && !addr.Is4In6() {
+			return addr, true
+		}
+	}
+	return netip.Addr{}, false
 }
 
 // RemoteEntriesMap is used to get a map of all entries which are remote
 func (ms *MetadataStore) RemoteEntriesMap() map[string]Entry {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
 	return ms.remote
 }
 
 // PeerEntriesMap is used to get a map of entries with only the peers
 func (ms *MetadataStore) PeerEntriesMap() map[string]Entry {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
 	return ms.peersMap
 }
 
 // RemoteNonPeerEntriesMap is used to get a map of all entries which are remote
 func (ms *MetadataStore) RemoteNonPeerEntriesMap() map[string]Entry {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
 	return ms.remoteNonPeersMap
 }
 
+// Diagnostics returns a snapshot of the store's internal state for
+// introspection.
+func (ms *MetadataStore) Diagnostics() Diagnostics {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return Diagnostics{
+		Entries:           ms.entries,
+		Local:             ms.local,
+		Remote:            ms.remote,
+		PeersMap:          ms.peersMap,
+		RemoteNonPeersMap: ms.remoteNonPeersMap,
+	}
+}
+
+// VerboseDiagnostics returns the raw metadata this store's entries
+// were derived from, so users can debug why a given container is or
+// isn't showing up as a tunnel endpoint.
+func (ms *MetadataStore) VerboseDiagnostics() interface{} {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	if ms.info == nil {
+		return nil
+	}
+
+	return struct {
+		SelfHost   metadata.Host               `json:"selfHost"`
+		Services   []metadata.Service          `json:"services"`
+		Hosts      []metadata.Host             `json:"hosts"`
+		Containers []metadata.Container        `json:"containers"`
+		Networks   map[string]metadata.Network `json:"networks"`
+	}{
+		SelfHost:   ms.info.selfHost,
+		Services:   ms.info.services,
+		Hosts:      ms.info.hosts,
+		Containers: ms.info.containers,
+		Networks:   ms.info.networksMap,
+	}
+}
+
 // getHostsMapFromHostsArray returns a map of hosts which can be looked up by UUID of the host
 func getHostsMapFromHostsArray(hosts []metadata.Host) map[string]metadata.Host {
 	hostsMap := map[string]metadata.Host{}
@@ -245,7 +405,11 @@ func (ms *MetadataStore) getLinkedPeersInfo() (map[string]bool, []metadata.Conta
 	var linkedPeersContainers []metadata.Container
 
 	// Find out if the current service has links else if other services link to current service
-	curServicePtr := ms.info.servicesMapByName["ipsec/ipsec"]
+	curServicePtr, ok := ms.info.servicesMapByName["ipsec/ipsec"]
+	if !ok || len(curServicePtr) == 0 {
+		log.Errorf("couldn't find ipsec/ipsec in servicesMapByName")
+		return linkedPeersNetworks, linkedPeersContainers
+	}
 	curService := *curServicePtr[0]
 	if len(curService.Links) > 0 {
 		for linkedServiceName := range curService.Links {
@@ -299,14 +463,18 @@ func (ms *MetadataStore) getLinkedPeersInfo() (map[string]bool, []metadata.Conta
 func (ms *MetadataStore) doInternalRefresh() {
 	log.Debugf("Doing internal refresh")
 
-	ms.self, _ = ms.getEntryFromHost(ms.info.selfHost)
+	self, _ := ms.getEntryFromHost(ms.info.selfHost)
+	ms.mu.Lock()
+	ms.self = self
+	ms.mu.Unlock()
 
 	seen := map[string]bool{}
 	entries := []Entry{}
 	local := map[string]Entry{}
 	remote := map[string]Entry{}
 	remoteNonPeersMap := map[string]Entry{}
-	//peersNetworks, linkedPeersContainers := ms.getLinkedPeersInfo()
+
+	peersNetworks, linkedPeersContainers := ms.getLinkedPeersInfo()
 
 	peersMap := ms.buildPeersMap()
 
@@ -315,52 +483,133 @@ func (ms *MetadataStore) doInternalRefresh() {
 			continue
 		}
 
-		// TODO:
-		// check if the container networkUUID is part of peersNetworks
-		//_, isPresentInPeersNetworks := peersNetworks[c.NetworkUUID]
+		_, isPresentInPeersNetworks := peersNetworks[c.NetworkUUID]
+		_, hasIp6 := primaryIp6FromIps(c.Ips)
 
-		//if !isPresentInPeersNetworks ||
-		if c.PrimaryIp == "" ||
+		if (c.PrimaryIp == "" && !hasIp6) ||
 			c.NetworkFromContainerUUID != "" ||
-			c.NetworkUUID != ms.info.selfNetwork.UUID ||
+			(c.NetworkUUID != ms.info.selfNetwork.UUID && !isPresentInPeersNetworks) ||
 			c.PrimaryIp == ms.info.selfHost.AgentIP ||
 			c.PrimaryIp == ms.info.hostsMap[c.HostUUID].AgentIP {
 			continue
 		}
 
-		log.Debugf("Getting Entry from Container: %+v", c)
-		e, _ := ms.getEntryFromContainer(c)
+		log.Debugf("Getting Entries from Container: %+v", c)
+		for _, e := range ms.getEntriesFromContainer(c) {
+			ipNoCidr := e.IPAddress.Addr().String()
 
-		ipNoCidr := strings.Split(e.IPAddress, "/")[0]
+			if seen[ipNoCidr] {
+				continue
+			}
+			seen[ipNoCidr] = true
 
-		if seen[ipNoCidr] {
+			if e.HostIPAddress == self.HostIPAddress {
+				local[ipNoCidr] = e
+			} else {
+				remote[ipNoCidr] = e
+				if !e.Peer {
+					remoteNonPeersMap[ipNoCidr] = e
+				}
+			}
+
+			log.Debugf("entry: %+v", e)
+			entries = append(entries, e)
+		}
+	}
+
+	// linkedPeersContainers come from an environment linked to this
+	// one in the Rancher UI; they are always remote, and are not
+	// peers in their own right.
+	for _, c := range linkedPeersContainers {
+		_, hasIp6 := primaryIp6FromIps(c.Ips)
+		if c.PrimaryIp == "" && !hasIp6 {
 			continue
 		}
-		seen[ipNoCidr] = true
 
-		if e.HostIPAddress == ms.self.HostIPAddress {
-			local[ipNoCidr] = e
-		} else {
-			remote[ipNoCidr] = e
-			if !e.Peer {
-				remoteNonPeersMap[ipNoCidr] = e
+		for _, e := range ms.getEntriesFromContainer(c) {
+			ipNoCidr := e.IPAddress.Addr().String()
+			if seen[ipNoCidr] {
+				continue
 			}
+			seen[ipNoCidr] = true
+
+			remote[ipNoCidr] = e
+			remoteNonPeersMap[ipNoCidr] = e
+			entries = append(entries, e)
 		}
+	}
 
-		log.Debugf("entry: %+v", e)
+	// Entries imported from explicitly established Peerings, on top
+	// of same-environment linked services above.
+	peeringPeersMap, peeringRemoteNonPeersMap := entriesFromPeerings(ms.peerings)
+	for key, e := range peeringPeersMap {
+		peersMap[key] = e
+	}
+	for key, e := range peeringRemoteNonPeersMap {
+		remote[key] = e
+		remoteNonPeersMap[key] = e
 		entries = append(entries, e)
 	}
 
+	var serviceVIPs map[string]ServiceVIPEntry
+	if ms.vipAllocator != nil {
+		serviceVIPs = ms.buildServiceVIPEntries()
+
+		for _, sv := range serviceVIPs {
+			e, ok := serviceVIPEntryToEntry(sv)
+			if !ok {
+				continue
+			}
+
+			ipNoCidr := e.IPAddress.Addr().String()
+			if seen[ipNoCidr] {
+				continue
+			}
+			seen[ipNoCidr] = true
+
+			if e.HostIPAddress == self.HostIPAddress {
+				local[ipNoCidr] = e
+			} else {
+				remote[ipNoCidr] = e
+				remoteNonPeersMap[ipNoCidr] = e
+			}
+			entries = append(entries, e)
+		}
+	}
+
 	log.Debugf("entries: %+v", entries)
 	log.Debugf("peersMap: %+v", peersMap)
 	log.Debugf("local: %+v", local)
 	log.Debugf("remote: %+v", remote)
 
+	ms.mu.Lock()
+	oldByKey := map[string]Entry{}
+	for k, e := range ms.local {
+		oldByKey[k] = e
+	}
+	for k, e := range ms.remote {
+		oldByKey[k] = e
+	}
+	oldPeersMap := ms.peersMap
+
+	newByKey := map[string]Entry{}
+	for k, e := range local {
+		newByKey[k] = e
+	}
+	for k, e := range remote {
+		newByKey[k] = e
+	}
+
 	ms.entries = entries
 	ms.peersMap = peersMap
 	ms.local = local
 	ms.remote = remote
 	ms.remoteNonPeersMap = remoteNonPeersMap
+	ms.serviceVIPs = serviceVIPs
+	ms.mu.Unlock()
+
+	ms.diffEntries(oldByKey, newByKey)
+	ms.diffPeers(oldPeersMap, peersMap)
 }
 
 // getServicesMapByName builds a map indexed by `stack_name/service_name`
@@ -388,24 +637,48 @@ func getServicesMapByName(services []metadata.Service) map[string][]*metadata.Se
 	return servicesMapByName
 }
 
-func getSubnetPrefixFromNetworkConfig(network metadata.Network) string {
+// getSubnetPrefixFromNetworkConfig reads the per-family prefix length
+// to use for container entries out of network's cniConfig, falling
+// back to defaultSubnetPrefixV4/V6 for whichever family is missing or
+// unparseable.
+func getSubnetPrefixFromNetworkConfig(network metadata.Network) subnetPrefixSizes {
+	sizes := subnetPrefixSizes{v4: defaultSubnetPrefixV4, v6: defaultSubnetPrefixV6}
+
 	conf, _ := network.Metadata["cniConfig"].(map[string]interface{})
 	for _, file := range conf {
 		props, _ := file.(map[string]interface{})
 		ipamConf, found := props["ipam"].(map[string]interface{})
 		if !found {
 			log.Errorf("couldn't find ipam key in network config")
-			return defaultSubnetPrefix
+			return sizes
 		}
 
-		sp, found := ipamConf["subnetPrefixSize"].(string)
-		if !found {
+		if sp, found := ipamConf["subnetPrefixSize"].(string); found {
+			if bits, err := parsePrefixSizeString(sp); err != nil {
+				log.Errorf("couldn't parse subnetPrefixSize %v: %v", sp, err)
+			} else {
+				sizes.v4 = bits
+			}
+		} else {
 			log.Errorf("couldn't find subnetPrefixSize in network ipam config")
-			return defaultSubnetPrefix
 		}
-		return sp
+
+		if sp6, found := ipamConf["subnetPrefixSizeV6"].(string); found {
+			if bits, err := parsePrefixSizeString(sp6); err != nil {
+				log.Errorf("couldn't parse subnetPrefixSizeV6 %v: %v", sp6, err)
+			} else {
+				sizes.v6 = bits
+			}
+		}
+
+		return sizes
 	}
-	return defaultSubnetPrefix
+	return sizes
+}
+
+// parsePrefixSizeString turns a cniConfig value like "/16" into 16.
+func parsePrefixSizeString(s string) (int, error) {
+	return strconv.Atoi(strings.TrimPrefix(s, "/"))
 }
 
 // Reload is used to refresh/reload the data from metadata
@@ -449,21 +722,23 @@ func (ms *MetadataStore) Reload() error {
 
 	selfNetwork := getSelfNetwork(networks)
 
-	selfNetworkSubnetPrefix := getSubnetPrefixFromNetworkConfig(selfNetwork)
+	selfNetworkSubnetPrefixes := getSubnetPrefixFromNetworkConfig(selfNetwork)
 
 	info := &InfoFromMetadata{
-		selfHost,
-		selfNetwork,
-		selfNetworkSubnetPrefix,
-		services,
-		servicesMapByName,
-		hosts,
-		containers,
-		hostsMap,
-		networksMap,
+		selfHost:                  selfHost,
+		selfNetwork:               selfNetwork,
+		selfNetworkSubnetPrefixes: selfNetworkSubnetPrefixes,
+		services:                  services,
+		servicesMapByName:         servicesMapByName,
+		hosts:                     hosts,
+		containers:                containers,
+		hostsMap:                  hostsMap,
+		networksMap:               networksMap,
 	}
 
+	ms.mu.Lock()
 	ms.info = info
+	ms.mu.Unlock()
 
 	ms.doInternalRefresh()
 
@@ -0,0 +1,170 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+
+	"github.com/leodotcloud/log"
+)
+
+// Peering names a remote environment that this agent should establish
+// ipsec tunnels with directly, without relying on Rancher service
+// links between environments. It is modeled on Consul's cluster
+// peering: a shared trust bundle plus the set of remote endpoints and
+// subnets to import.
+type Peering struct {
+	// Name identifies the peering and is stamped onto every Entry it
+	// produces via Entry.PeeringName.
+	Name string
+
+	// PSK is the pre-shared key used to authenticate tunnels to this
+	// peering's AgentIPs. Either PSK or CertBundle (or both) must be set.
+	PSK string
+
+	// CertBundle is an optional PEM-encoded trust bundle used instead
+	// of (or in addition to) a PSK.
+	CertBundle []byte
+
+	// AgentIPs are the remote hosts this peering's tunnels terminate on.
+	AgentIPs []string
+
+	// Subnets are the remote container subnets (CIDR) to import,
+	// routed via the AgentIPs above.
+	Subnets []string
+}
+
+// peeringToken is the wire format of a Peering, base64-encoded JSON so
+// it can be pasted between operators the same way a Consul peering
+// token or a WireGuard config is.
+type peeringToken struct {
+	Name       string   `json:"name"`
+	PSK        string   `json:"psk,omitempty"`
+	CertBundle []byte   `json:"certBundle,omitempty"`
+	AgentIPs   []string `json:"agentIPs"`
+	Subnets    []string `json:"subnets"`
+}
+
+// GeneratePeeringToken produces a portable token for p that can be
+// handed to a remote agent's EstablishPeering to complete the peering.
+func GeneratePeeringToken(p Peering) (string, error) {
+	t := peeringToken{
+		Name:       p.Name,
+		PSK:        p.PSK,
+		CertBundle: p.CertBundle,
+		AgentIPs:   p.AgentIPs,
+		Subnets:    p.Subnets,
+	}
+
+	raw, err := json.Marshal(t)
+	if err != nil {
+		log.Errorf("couldn't marshal peering token: %v", err)
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// decodePeeringToken is the inverse of GeneratePeeringToken.
+func decodePeeringToken(token string) (Peering, error) {
+	raw, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return Peering{}, fmt.Errorf("couldn't decode peering token: %v", err)
+	}
+
+	var t peeringToken
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return Peering{}, fmt.Errorf("couldn't unmarshal peering token: %v", err)
+	}
+
+	if t.Name == "" {
+		return Peering{}, fmt.Errorf("peering token is missing a name")
+	}
+
+	return Peering{
+		Name:       t.Name,
+		PSK:        t.PSK,
+		CertBundle: t.CertBundle,
+		AgentIPs:   t.AgentIPs,
+		Subnets:    t.Subnets,
+	}, nil
+}
+
+// EstablishPeering decodes token and adds it to the set of peerings
+// this store imports entries from on every Reload. An existing peering
+// with the same name is replaced.
+func (ms *MetadataStore) EstablishPeering(token string) error {
+	p, err := decodePeeringToken(token)
+	if err != nil {
+		log.Errorf("couldn't establish peering: %v", err)
+		return err
+	}
+
+	if ms.peerings == nil {
+		ms.peerings = map[string]Peering{}
+	}
+	ms.peerings[p.Name] = p
+
+	log.Debugf("Established peering: %v", p.Name)
+	return nil
+}
+
+// RemovePeering stops importing entries from the named peering.
+func (ms *MetadataStore) RemovePeering(name string) {
+	delete(ms.peerings, name)
+}
+
+// entriesFromPeerings builds the peer and subnet Entry values imported
+// from every established Peering, keyed by IP address the same way
+// buildPeersMap and doInternalRefresh key local/remote.
+func entriesFromPeerings(peerings map[string]Peering) (peersMap map[string]Entry, remoteNonPeersMap map[string]Entry) {
+	peersMap = map[string]Entry{}
+	remoteNonPeersMap = map[string]Entry{}
+
+	for _, p := range peerings {
+		var firstAgentAddr netip.Addr
+
+		for _, agentIP := range p.AgentIPs {
+			addr, err := netip.ParseAddr(agentIP)
+			if err != nil {
+				log.Errorf("peering %v has unparseable AgentIP %v: %v", p.Name, agentIP, err)
+				continue
+			}
+			if !firstAgentAddr.IsValid() {
+				firstAgentAddr = addr
+			}
+
+			peersMap[addr.String()] = Entry{
+				IPAddress:     netip.PrefixFrom(addr, hostPrefixBits(addr)),
+				HostIPAddress: addr,
+				Self:          false,
+				Peer:          true,
+				PeeringName:   p.Name,
+			}
+		}
+
+		if !firstAgentAddr.IsValid() {
+			log.Errorf("peering %v has no usable AgentIPs, skipping its subnets", p.Name)
+			continue
+		}
+
+		for _, subnet := range p.Subnets {
+			prefix, err := netip.ParsePrefix(subnet)
+			if err != nil {
+				log.Errorf("peering %v has unparseable subnet %v: %v", p.Name, subnet, err)
+				continue
+			}
+
+			remoteNonPeersMap[prefix.Addr().String()] = Entry{
+				IPAddress:     prefix,
+				HostIPAddress: firstAgentAddr,
+				Self:          false,
+				Peer:          false,
+				PeeringName:   p.Name,
+			}
+		}
+	}
+
+	return peersMap, remoteNonPeersMap
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPeeringTokenRoundTrip(t *testing.T) {
+	p := Peering{
+		Name:     "prod-east",
+		PSK:      "s3cr3t",
+		AgentIPs: []string{"10.0.0.1", "10.0.0.2"},
+		Subnets:  []string{"10.42.0.0/16"},
+	}
+
+	token, err := GeneratePeeringToken(p)
+	if err != nil {
+		t.Fatalf("GeneratePeeringToken: %v", err)
+	}
+
+	got, err := decodePeeringToken(token)
+	if err != nil {
+		t.Fatalf("decodePeeringToken: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, p) {
+		t.Fatalf("decodePeeringToken(GeneratePeeringToken(p)) = %+v, want %+v", got, p)
+	}
+}
+
+func TestDecodePeeringTokenRejectsMissingName(t *testing.T) {
+	token, err := GeneratePeeringToken(Peering{AgentIPs: []string{"10.0.0.1"}})
+	if err != nil {
+		t.Fatalf("GeneratePeeringToken: %v", err)
+	}
+
+	if _, err := decodePeeringToken(token); err == nil {
+		t.Fatalf("expected decodePeeringToken to reject a peering token with no name")
+	}
+}
+
+func TestEntriesFromPeeringsUsesFirstParseableAgentIP(t *testing.T) {
+	peerings := map[string]Peering{
+		"prod-east": {
+			Name:     "prod-east",
+			AgentIPs: []string{"not-an-ip", "10.0.0.2", "10.0.0.3"},
+			Subnets:  []string{"10.42.0.0/16"},
+		},
+	}
+
+	_, remoteNonPeersMap := entriesFromPeerings(peerings)
+
+	e, ok := remoteNonPeersMap["10.42.0.0"]
+	if !ok {
+		t.Fatalf("expected a subnet entry for 10.42.0.0/16")
+	}
+	if e.HostIPAddress.String() != "10.0.0.2" {
+		t.Fatalf("expected subnet entry to route via the first parseable AgentIP 10.0.0.2, got %v", e.HostIPAddress)
+	}
+}
@@ -0,0 +1,147 @@
+package store
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/leodotcloud/log"
+)
+
+// defaultResolveInterval is how often a hostnameResolver re-resolves
+// the hostnames it has been asked about.
+const defaultResolveInterval = 30 * time.Second
+
+// AddressChangeEvent is emitted on a hostnameResolver's Events channel
+// whenever a watched hostname's resolved IPs change. MetadataStore does
+// not read these events; it picks up the re-resolved IPs on its next
+// Reload.
+type AddressChangeEvent struct {
+	Hostname string
+	OldIPs   []string
+	NewIPs   []string
+}
+
+// hostnameResolver periodically re-resolves a set of hostnames via
+// A/AAAA lookups and emits an AddressChangeEvent on Events() whenever
+// a hostname's resolved IP set changes.
+type hostnameResolver struct {
+	interval time.Duration
+	events   chan AddressChangeEvent
+	stopCh   chan struct{}
+
+	mu  sync.Mutex
+	ips map[string][]string
+}
+
+// newHostnameResolver creates a resolver that re-checks every interval
+// (defaultResolveInterval if interval <= 0). Run must be called to
+// start the periodic loop.
+func newHostnameResolver(interval time.Duration) *hostnameResolver {
+	if interval <= 0 {
+		interval = defaultResolveInterval
+	}
+
+	return &hostnameResolver{
+		interval: interval,
+		events:   make(chan AddressChangeEvent, 16),
+		stopCh:   make(chan struct{}),
+		ips:      map[string][]string{},
+	}
+}
+
+// Events returns the channel AddressChangeEvents are emitted on.
+func (r *hostnameResolver) Events() <-chan AddressChangeEvent {
+	return r.events
+}
+
+// Resolve returns the IPs currently known for hostname, performing an
+// initial lookup and beginning to track it if it hasn't been seen
+// before.
+func (r *hostnameResolver) Resolve(hostname string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ips, ok := r.ips[hostname]
+	if !ok {
+		ips = lookupHost(hostname)
+		r.ips[hostname] = ips
+	}
+	return ips
+}
+
+// Run starts the periodic re-resolution loop. It blocks until Stop is
+// called, so callers should run it in its own goroutine.
+func (r *hostnameResolver) Run() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.refreshAll()
+		case <-r.stopCh:
+			return
+		}
+	}
+}
+
+// Stop ends the periodic re-resolution loop.
+func (r *hostnameResolver) Stop() {
+	close(r.stopCh)
+}
+
+func (r *hostnameResolver) refreshAll() {
+	r.mu.Lock()
+	hostnames := make([]string, 0, len(r.ips))
+	for h := range r.ips {
+		hostnames = append(hostnames, h)
+	}
+	r.mu.Unlock()
+
+	for _, hostname := range hostnames {
+		newIPs := lookupHost(hostname)
+
+		r.mu.Lock()
+		oldIPs := r.ips[hostname]
+		r.ips[hostname] = newIPs
+		r.mu.Unlock()
+
+		if sameIPs(oldIPs, newIPs) {
+			continue
+		}
+
+		log.Debugf("hostname %v resolved IPs changed: %v -> %v", hostname, oldIPs, newIPs)
+		select {
+		case r.events <- AddressChangeEvent{Hostname: hostname, OldIPs: oldIPs, NewIPs: newIPs}:
+		default:
+			log.Errorf("dropping address change event for %v, events channel is full", hostname)
+		}
+	}
+}
+
+func lookupHost(hostname string) []string {
+	ips, err := net.LookupHost(hostname)
+	if err != nil {
+		log.Errorf("couldn't resolve hostname %v: %v", hostname, err)
+		return nil
+	}
+	return ips
+}
+
+func sameIPs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	seen := map[string]bool{}
+	for _, ip := range a {
+		seen[ip] = true
+	}
+	for _, ip := range b {
+		if !seen[ip] {
+			return false
+		}
+	}
+	return true
+}
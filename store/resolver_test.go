@@ -0,0 +1,33 @@
+package store
+
+import "testing"
+
+func TestSameIPsIgnoresOrder(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b []string
+		want bool
+	}{
+		{"identical", []string{"10.0.0.1", "10.0.0.2"}, []string{"10.0.0.1", "10.0.0.2"}, true},
+		{"reordered", []string{"10.0.0.1", "10.0.0.2"}, []string{"10.0.0.2", "10.0.0.1"}, true},
+		{"changed", []string{"10.0.0.1"}, []string{"10.0.0.2"}, false},
+		{"grew", []string{"10.0.0.1"}, []string{"10.0.0.1", "10.0.0.2"}, false},
+		{"both empty", nil, nil, true},
+	}
+
+	for _, c := range cases {
+		if got := sameIPs(c.a, c.b); got != c.want {
+			t.Errorf("%v: sameIPs(%v, %v) = %v, want %v", c.name, c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestHostnameResolverResolveReusesTrackedIPs(t *testing.T) {
+	r := newHostnameResolver(0)
+	r.ips["example.invalid"] = []string{"10.0.0.1"}
+
+	got := r.Resolve("example.invalid")
+	if len(got) != 1 || got[0] != "10.0.0.1" {
+		t.Fatalf("Resolve returned %v, want the already-tracked IPs to be reused", got)
+	}
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"net"
+	"net/netip"
+)
+
+// Entry represents a single tunnel endpoint known to the store, whether
+// it originates from a Rancher host, a container, or some other
+// backend's equivalent concept. IPAddress and HostIPAddress are
+// netip values rather than ad-hoc strings so IPv4 and IPv6 entries can
+// coexist in the same maps without string-format footguns, and so
+// Entry stays comparable with == (netip.Addr and netip.Prefix are
+// plain value types), which the event diffing in events.go relies on.
+type Entry struct {
+	// IPAddress is the entry's own address and prefix length, e.g. a
+	// host's /32 (or /128), a container's address with its network's
+	// subnet prefix, or a subnet imported from a Peering.
+	IPAddress netip.Prefix
+
+	// HostIPAddress is the agent address of the host this entry is
+	// reachable through.
+	HostIPAddress netip.Addr
+
+	Self bool
+	Peer bool
+
+	// PeeringName is the name of the Peering this entry was imported
+	// from, letting the ipsec configurator install a distinct SPD/SAD
+	// entry per peering. Entries discovered within the local Rancher
+	// environment leave this empty.
+	PeeringName string
+
+	// HostAddressType classifies the host's original agent address (as
+	// read from metadata, before resolution) as a literal IP or a
+	// hostname that needs periodic re-resolution. Entries whose host
+	// is addressed by hostname are not rewritten in place when the
+	// hostname's A/AAAA records change; the next Reload rebuilds them
+	// from the re-resolved address.
+	HostAddressType addressType
+}
+
+// hostPrefixBits returns the prefix length that makes a single host
+// address into the corresponding "whole address" CIDR: /32 for IPv4,
+// /128 for IPv6.
+func hostPrefixBits(addr netip.Addr) int {
+	if addr.Is4() {
+		return 32
+	}
+	return 128
+}
+
+// addressType classifies a host address as either a routable IP
+// literal or a hostname that must be resolved, as Consul's mesh
+// gateway does for its WAN addresses.
+type addressType int
+
+const (
+	ipAddressType addressType = iota
+	hostnameAddressType
+)
+
+// classifyAddress returns hostnameAddressType for anything that isn't
+// a parseable IP literal.
+func classifyAddress(addr string) addressType {
+	if net.ParseIP(addr) != nil {
+		return ipAddressType
+	}
+	return hostnameAddressType
+}
+
+// Store is implemented by anything that can discover tunnel endpoints
+// and hand them back to the ipsec configurator. MetadataStore is the
+// original Rancher-metadata-backed implementation; other backends
+// (Consul, Kubernetes, ...) let the agent run outside Rancher by
+// satisfying the same interface.
+type Store interface {
+	// Entries returns every entry currently known to the store.
+	Entries() []Entry
+
+	// LocalIPAddress returns the IP address of the agent running locally.
+	LocalIPAddress() string
+
+	// IsRemote reports whether ipAddress belongs to a remote entry as
+	// opposed to one running on the local host.
+	IsRemote(ipAddress string) bool
+
+	// PeerEntriesMap returns the entries that represent ipsec peers,
+	// keyed by IP address.
+	PeerEntriesMap() map[string]Entry
+
+	// RemoteNonPeerEntriesMap returns the remote entries that are not
+	// themselves peers, keyed by IP address.
+	RemoteNonPeerEntriesMap() map[string]Entry
+
+	// Reload refreshes the store's view of the backend.
+	Reload() error
+
+	// Subscribe returns a channel of StoreEvents describing the diffs
+	// each Reload discovers, so consumers can reconcile incrementally
+	// instead of walking the full snapshot every time.
+	Subscribe() <-chan StoreEvent
+}
+
+// Assert that MetadataStore satisfies Store.
+var _ Store = (*MetadataStore)(nil)
+
+// Assert that every backend can be introspected via ServeDiagnostics.
+var (
+	_ Diagnosable = (*MetadataStore)(nil)
+	_ Diagnosable = (*ConsulStore)(nil)
+	_ Diagnosable = (*KubernetesStore)(nil)
+
+	_ VerboseDiagnosable = (*MetadataStore)(nil)
+)
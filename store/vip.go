@@ -0,0 +1,241 @@
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+
+	"github.com/leodotcloud/log"
+	"github.com/rancher/go-rancher-metadata/metadata"
+)
+
+// defaultVIPCIDR mirrors Consul catalog's startingVirtualIP default:
+// a /12 carved out of the unused 240.0.0.0/4 "reserved" IPv4 range,
+// so service VIPs can't collide with anything actually routed.
+const defaultVIPCIDR = "240.0.0.0/12"
+
+// ServiceVIPEntry is a stable virtual IP assigned to a Rancher service
+// (as opposed to Entry, which is per-container). It always routes to
+// whichever host currently holds a healthy container of that service,
+// so clients get an address that survives container restarts and
+// rescheduling.
+type ServiceVIPEntry struct {
+	ServiceName   string
+	VIPAddress    string
+	HostIPAddress string
+	Self          bool
+}
+
+// VIPPersister saves and loads service-to-VIP allocations so they
+// survive agent restarts. MetadataStore has no writable backing store
+// of its own, so callers wire in an implementation backed by metadata
+// (e.g. a label on the service) or by the pluggable Store's own
+// backend (a Consul KV key, a Kubernetes annotation, ...).
+type VIPPersister interface {
+	LoadVIPAllocations() (map[string]string, error)
+	SaveVIPAllocations(map[string]string) error
+}
+
+// vipAllocator hands out stable virtual IPs from a CIDR, one per
+// service name, and keeps the allocation table durable via an
+// optional VIPPersister.
+type vipAllocator struct {
+	mu          sync.Mutex
+	startIP     uint32
+	maxOffset   uint32
+	allocations map[string]string
+	used        map[string]bool
+	persister   VIPPersister
+}
+
+func newVIPAllocator(cidr string, persister VIPPersister) (*vipAllocator, error) {
+	if cidr == "" {
+		cidr = defaultVIPCIDR
+	}
+
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VIP CIDR %v: %v", cidr, err)
+	}
+
+	ones, bits := ipnet.Mask.Size()
+	va := &vipAllocator{
+		startIP:     ipToUint32(ipnet.IP),
+		maxOffset:   uint32(1)<<uint(bits-ones) - 1,
+		allocations: map[string]string{},
+		used:        map[string]bool{},
+		persister:   persister,
+	}
+
+	if persister != nil {
+		existing, err := persister.LoadVIPAllocations()
+		if err != nil {
+			log.Errorf("couldn't load existing VIP allocations, starting fresh: %v", err)
+		} else {
+			for service, vip := range existing {
+				va.allocations[service] = vip
+				va.used[vip] = true
+			}
+		}
+	}
+
+	return va, nil
+}
+
+// Allocate returns the VIP assigned to service, assigning and
+// persisting a new one from the configured CIDR if it doesn't have
+// one yet.
+func (va *vipAllocator) Allocate(service string) (string, error) {
+	va.mu.Lock()
+	defer va.mu.Unlock()
+
+	if vip, ok := va.allocations[service]; ok {
+		return vip, nil
+	}
+
+	for offset := uint32(0); offset <= va.maxOffset; offset++ {
+		candidate := uint32ToIP(va.startIP + offset).String()
+		if va.used[candidate] {
+			continue
+		}
+
+		va.allocations[service] = candidate
+		va.used[candidate] = true
+
+		if va.persister != nil {
+			if err := va.persister.SaveVIPAllocations(va.allocations); err != nil {
+				log.Errorf("couldn't persist VIP allocation for service %v: %v", service, err)
+			}
+		}
+
+		return candidate, nil
+	}
+
+	return "", fmt.Errorf("no free VIPs left in the configured CIDR")
+}
+
+func ipToUint32(ip net.IP) uint32 {
+	ip4 := ip.To4()
+	return binary.BigEndian.Uint32(ip4)
+}
+
+func uint32ToIP(v uint32) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, v)
+	return ip
+}
+
+// EnableServiceVIPs turns on virtual-IP allocation for services,
+// drawing addresses from cidr (defaultVIPCIDR if empty) and persisting
+// the allocation table via persister (which may be nil to keep
+// allocations in memory only, e.g. for testing). Reload will start
+// emitting a ServiceVIPEntry - and a matching tunnel Entry - for every
+// service that has at least one healthy container.
+func (ms *MetadataStore) EnableServiceVIPs(cidr string, persister VIPPersister) error {
+	va, err := newVIPAllocator(cidr, persister)
+	if err != nil {
+		return err
+	}
+
+	ms.vipAllocator = va
+	return nil
+}
+
+// ServiceVIPEntriesMap returns the current service-name-to-VIP-entry
+// mapping. Empty if EnableServiceVIPs hasn't been called.
+func (ms *MetadataStore) ServiceVIPEntriesMap() map[string]ServiceVIPEntry {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.serviceVIPs
+}
+
+// buildServiceVIPEntries allocates (or reuses) a VIP for every service
+// that currently has at least one healthy container, routing it to
+// that container's host. It considers every Rancher service, not just
+// the System ones ms.info.servicesMapByName is filtered down to for
+// the Rancher-UI service-link lookup.
+func (ms *MetadataStore) buildServiceVIPEntries() map[string]ServiceVIPEntry {
+	result := map[string]ServiceVIPEntry{}
+
+	for serviceName, services := range groupServicesByName(ms.info.services) {
+		hostAgentIP := ms.pickHealthyServiceHost(services)
+		if hostAgentIP == "" {
+			continue
+		}
+
+		vip, err := ms.vipAllocator.Allocate(serviceName)
+		if err != nil {
+			log.Errorf("couldn't allocate VIP for service %v: %v", serviceName, err)
+			continue
+		}
+
+		result[serviceName] = ServiceVIPEntry{
+			ServiceName:   serviceName,
+			VIPAddress:    vip,
+			HostIPAddress: hostAgentIP,
+			Self:          hostAgentIP == ms.self.HostIPAddress.String(),
+		}
+	}
+
+	return result
+}
+
+// groupServicesByName indexes services by "stack_name/service_name",
+// the same key scheme as getServicesMapByName, but without its System
+// filter: VIP allocation is for ordinary user stacks/services, not
+// just the ones relevant to Rancher-UI service links.
+func groupServicesByName(services []metadata.Service) map[string][]*metadata.Service {
+	servicesMapByName := make(map[string][]*metadata.Service)
+	for index, aService := range services {
+		key := aService.StackName + "/" + aService.Name
+		servicesMapByName[key] = append(servicesMapByName[key], &services[index])
+	}
+	return servicesMapByName
+}
+
+// pickHealthyServiceHost returns the agent IP (resolved, if the host's
+// AgentIP is a hostname) of a host running a healthy container of one
+// of the given service copies, or "" if none are currently healthy.
+func (ms *MetadataStore) pickHealthyServiceHost(services []*metadata.Service) string {
+	for _, svc := range services {
+		for _, c := range svc.Containers {
+			if c.State != "running" {
+				continue
+			}
+			if h, ok := ms.info.hostsMap[c.HostUUID]; ok {
+				if resolvedIP, _ := ms.resolveAgentAddress(h.AgentIP); resolvedIP != "" {
+					return resolvedIP
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// serviceVIPEntryToEntry converts a ServiceVIPEntry into the Entry
+// form doInternalRefresh uses to drive tunnel installation. It reports
+// false if sv's addresses can't be parsed, which shouldn't happen since
+// both come from vipAllocator/metadata but is checked anyway since
+// they've crossed a string boundary (VIPPersister, Rancher metadata).
+func serviceVIPEntryToEntry(sv ServiceVIPEntry) (Entry, bool) {
+	vip, err := netip.ParseAddr(sv.VIPAddress)
+	if err != nil {
+		log.Errorf("couldn't parse service VIP %v: %v", sv.VIPAddress, err)
+		return Entry{}, false
+	}
+
+	hostIP, err := netip.ParseAddr(sv.HostIPAddress)
+	if err != nil {
+		log.Errorf("couldn't parse service VIP host address %v: %v", sv.HostIPAddress, err)
+		return Entry{}, false
+	}
+
+	return Entry{
+		IPAddress:     netip.PrefixFrom(vip, hostPrefixBits(vip)),
+		HostIPAddress: hostIP,
+		Self:          sv.Self,
+		Peer:          false,
+	}, true
+}
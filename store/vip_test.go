@@ -0,0 +1,51 @@
+package store
+
+import "testing"
+
+func TestVIPAllocatorAllocateIsSequentialAndStable(t *testing.T) {
+	va, err := newVIPAllocator("240.0.0.0/30", nil)
+	if err != nil {
+		t.Fatalf("newVIPAllocator: %v", err)
+	}
+
+	first, err := va.Allocate("stack/svc-a")
+	if err != nil {
+		t.Fatalf("Allocate svc-a: %v", err)
+	}
+	if first != "240.0.0.0" {
+		t.Fatalf("expected first allocation to be 240.0.0.0, got %v", first)
+	}
+
+	second, err := va.Allocate("stack/svc-b")
+	if err != nil {
+		t.Fatalf("Allocate svc-b: %v", err)
+	}
+	if second != "240.0.0.1" {
+		t.Fatalf("expected second allocation to be 240.0.0.1, got %v", second)
+	}
+
+	again, err := va.Allocate("stack/svc-a")
+	if err != nil {
+		t.Fatalf("re-Allocate svc-a: %v", err)
+	}
+	if again != first {
+		t.Fatalf("expected re-allocating svc-a to return the same VIP %v, got %v", first, again)
+	}
+}
+
+func TestVIPAllocatorAllocateExhaustsCIDR(t *testing.T) {
+	va, err := newVIPAllocator("240.0.0.0/31", nil)
+	if err != nil {
+		t.Fatalf("newVIPAllocator: %v", err)
+	}
+
+	if _, err := va.Allocate("stack/svc-a"); err != nil {
+		t.Fatalf("Allocate svc-a: %v", err)
+	}
+	if _, err := va.Allocate("stack/svc-b"); err != nil {
+		t.Fatalf("Allocate svc-b: %v", err)
+	}
+	if _, err := va.Allocate("stack/svc-c"); err == nil {
+		t.Fatalf("expected Allocate to fail once the /31 CIDR is exhausted")
+	}
+}